@@ -0,0 +1,83 @@
+// Copyright (c) 2019 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// RequestContext carries per-request admission metadata that mutators can inspect when they need it to decide
+// whether to perform side effects, e.g. skipping a cloud API call while a request is only being dry-run.
+type RequestContext struct {
+	// DryRun is true if the AdmissionRequest is a dry run, i.e. none of its side effects will be persisted.
+	DryRun bool
+	// Operation is the admission operation being performed (CREATE, UPDATE, DELETE, or CONNECT).
+	Operation admissionv1.Operation
+}
+
+type requestContextKey struct{}
+
+// withRequestContext returns a copy of ctx carrying rc, retrievable via RequestContextFromContext.
+func withRequestContext(ctx context.Context, rc RequestContext) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, rc)
+}
+
+// RequestContextFromContext extracts the RequestContext the handler stored on ctx for the current admission
+// request. ok is false if ctx was not produced by the webhook handler.
+func RequestContextFromContext(ctx context.Context) (RequestContext, bool) {
+	rc, ok := ctx.Value(requestContextKey{}).(RequestContext)
+	return rc, ok
+}
+
+// OperationsMutator is an optional interface a Mutator or WarningMutator can implement to declare which admission
+// operations it should run for. The handler skips invoking the mutator entirely for any other operation. Mutators
+// that don't implement this interface are invoked for every operation.
+type OperationsMutator interface {
+	// Operations returns the admission operations this mutator should be invoked for.
+	Operations() []admissionv1.Operation
+}
+
+// DryRunAware is a marker interface a Mutator can implement to declare that it honours the dry-run contract: when
+// RequestContext.DryRun is true (retrievable from the context passed to Mutate via RequestContextFromContext), the
+// mutator must still compute and return the same object changes it would for a real request, but must not perform
+// any side effect outside of the returned object, e.g. no calls that create or modify cloud resources. Mutators
+// without side effects trivially satisfy this contract and don't need to implement the interface; it exists so that
+// mutators with side effects can self-document that they have been checked against it.
+type DryRunAware interface {
+	// DryRunSafe is never called. Its only purpose is to mark the implementing type as honouring the dry-run
+	// contract documented on DryRunAware.
+	DryRunSafe()
+}
+
+// OperationPredicate is an optional interface a predicate.Predicate can implement to additionally filter requests
+// by admission operation. For operations it is not registered for, the predicate is skipped rather than evaluated,
+// i.e. it does not gate the request for those operations.
+type OperationPredicate interface {
+	predicate.Predicate
+	// ForOperations returns the admission operations this predicate should be evaluated for.
+	ForOperations() []admissionv1.Operation
+}
+
+func appliesToOperation(op admissionv1.Operation, ops []admissionv1.Operation) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
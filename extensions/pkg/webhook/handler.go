@@ -19,11 +19,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	extensionspredicate "github.com/gardener/gardener/extensions/pkg/predicate"
+	"github.com/gardener/gardener/extensions/pkg/webhook/metrics"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,9 +42,20 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
+// tracerName identifies the spans this package creates in trace backends.
+const tracerName = "github.com/gardener/gardener/extensions/pkg/webhook"
+
+// mutatorRegistration pairs a mutator (a Mutator, WarningMutator, or a hybrid validator wrapper) with the types it
+// was registered for. Keeping registrations in a slice, rather than keying a map by type, is what lets
+// HandlerBuilder preserve the order in which WithMutator/WithValidator were called.
+type mutatorRegistration struct {
+	mutator interface{}
+	types   []runtime.Object
+}
+
 // HandlerBuilder contains information which are required to create an admission handler.
 type HandlerBuilder struct {
-	mutatorMap map[Mutator][]runtime.Object
+	mutators   []mutatorRegistration
 	predicates []predicate.Predicate
 	scheme     *runtime.Scheme
 	logger     logr.Logger
@@ -47,23 +64,35 @@ type HandlerBuilder struct {
 // NewBuilder creates a new HandlerBuilder.
 func NewBuilder(mgr manager.Manager, logger logr.Logger) *HandlerBuilder {
 	return &HandlerBuilder{
-		mutatorMap: make(map[Mutator][]runtime.Object),
-		scheme:     mgr.GetScheme(),
-		logger:     logger.WithName("handler"),
+		scheme: mgr.GetScheme(),
+		logger: logger.WithName("handler"),
 	}
 }
 
-// WithMutator adds the given mutator for the given types to the HandlerBuilder.
+// WithMutator adds the given mutator for the given types to the HandlerBuilder. Multiple mutators can be registered
+// for the same type; they are run in registration order.
 func (b *HandlerBuilder) WithMutator(mutator Mutator, types ...runtime.Object) *HandlerBuilder {
-	b.mutatorMap[mutator] = append(b.mutatorMap[mutator], types...)
+	b.mutators = append(b.mutators, mutatorRegistration{mutator: mutator, types: types})
+	return b
+}
 
+// WithWarningMutator adds the given mutator, which can also return admission warnings, for the given types.
+func (b *HandlerBuilder) WithWarningMutator(mutator WarningMutator, types ...runtime.Object) *HandlerBuilder {
+	b.mutators = append(b.mutators, mutatorRegistration{mutator: mutator, types: types})
 	return b
 }
 
 // WithValidator adds the given validator for the given types to the HandlerBuilder.
 func (b *HandlerBuilder) WithValidator(validator Validator, types ...runtime.Object) *HandlerBuilder {
-	mutator := hybridValidator(validator)
-	b.mutatorMap[mutator] = append(b.mutatorMap[mutator], types...)
+	mutator := &hybridValidator{Validator: validator}
+	b.mutators = append(b.mutators, mutatorRegistration{mutator: mutator, types: types})
+	return b
+}
+
+// WithWarningValidator adds the given validator, which can also return admission warnings, for the given types.
+func (b *HandlerBuilder) WithWarningValidator(validator WarningValidator, types ...runtime.Object) *HandlerBuilder {
+	mutator := &hybridWarningValidator{WarningValidator: validator}
+	b.mutators = append(b.mutators, mutatorRegistration{mutator: mutator, types: types})
 	return b
 }
 
@@ -77,21 +106,20 @@ func (b *HandlerBuilder) WithPredicates(predicates ...predicate.Predicate) *Hand
 func (b *HandlerBuilder) Build() (admission.Handler, error) {
 	h := &handler{
 		typesMap:   make(map[metav1.GroupVersionKind]runtime.Object),
-		mutatorMap: make(map[metav1.GroupVersionKind]Mutator),
+		mutatorMap: make(map[metav1.GroupVersionKind][]interface{}),
 		predicates: b.predicates,
 		scheme:     b.scheme,
 		logger:     b.logger,
 	}
 
-	for m, t := range b.mutatorMap {
-		typesMap, err := buildTypesMap(b.scheme, t)
+	for _, reg := range b.mutators {
+		typesMap, err := buildTypesMap(b.scheme, reg.types)
 		if err != nil {
 			return nil, err
 		}
-		mutator := m
 		for gvk, obj := range typesMap {
 			h.typesMap[gvk] = obj
-			h.mutatorMap[gvk] = mutator
+			h.mutatorMap[gvk] = append(h.mutatorMap[gvk], reg.mutator)
 		}
 	}
 	h.decoder = serializer.NewCodecFactory(b.scheme).UniversalDecoder()
@@ -101,7 +129,7 @@ func (b *HandlerBuilder) Build() (admission.Handler, error) {
 
 type handler struct {
 	typesMap   map[metav1.GroupVersionKind]runtime.Object
-	mutatorMap map[metav1.GroupVersionKind]Mutator
+	mutatorMap map[metav1.GroupVersionKind][]interface{}
 	predicates []predicate.Predicate
 	decoder    runtime.Decoder
 	scheme     *runtime.Scheme
@@ -110,9 +138,11 @@ type handler struct {
 
 // InjectFunc calls the inject.Func on the handler mutators.
 func (h *handler) InjectFunc(f inject.Func) error {
-	for _, mutator := range h.mutatorMap {
-		if err := f(mutator); err != nil {
-			return errors.Wrap(err, "could not inject into the mutator")
+	for _, mutators := range h.mutatorMap {
+		for _, mutator := range mutators {
+			if err := f(mutator); err != nil {
+				return errors.Wrap(err, "could not inject into the mutator")
+			}
 		}
 	}
 	return nil
@@ -137,30 +167,46 @@ func (h *handler) Handle(ctx context.Context, req admission.Request) admission.R
 		}
 	}
 
-	mutator, ok := h.mutatorMap[ar.Kind]
+	mutators, ok := h.mutatorMap[ar.Kind]
 	if !ok {
 		// check if we can find an internal type
 		for gvk, m := range h.mutatorMap {
 			if gvk.Version == runtime.APIVersionInternal && gvk.Group == ar.Kind.Group && gvk.Kind == ar.Kind.Kind {
-				mutator = m
+				mutators = m
 				break
 			}
 		}
-		if mutator == nil {
+		if mutators == nil {
 			return admission.Errored(http.StatusBadRequest, errors.Errorf("unexpected request kind %s", ar.Kind.String()))
 		}
 	}
 
-	return handle(ctx, req, mutator, t, h.decoder, h.logger, h.predicates...)
+	return handle(ctx, req, mutators, t, h.decoder, h.logger, h.predicates...)
 }
 
-func handle(ctx context.Context, req admission.Request, m Mutator, t runtime.Object, decoder runtime.Decoder, logger logr.Logger, predicates ...predicate.Predicate) admission.Response {
+// handle decodes the request's object, runs it through predicates, and then feeds it through the given mutators in
+// order, in a chain: each mutator receives the object produced by the previous one. Validators (including
+// warning-returning ones) are read-only steps that can contribute errors and warnings but never change the object.
+// Mutators that implement OperationsMutator are skipped for operations they did not register for, and predicates
+// that implement OperationPredicate are likewise skipped for operations outside their own list. Processing stops at
+// the first error. The JSON patch returned to the API server, if any, is computed once between the original and the
+// final object, so it already reflects the cumulative effect of the whole chain.
+//
+// Before invoking a mutator, handle stores a RequestContext on ctx (retrievable via RequestContextFromContext) that
+// exposes whether the request is a dry run and which operation it is. The patch is always computed and returned for
+// a dry run exactly as for a real request; it is the responsibility of mutators with external side effects (calling
+// out to cloud APIs, for instance) to check RequestContext.DryRun themselves and skip those side effects. Mutators
+// that have been checked against this contract may implement the DryRunAware marker interface to document that.
+func handle(ctx context.Context, req admission.Request, mutators []interface{}, t runtime.Object, decoder runtime.Decoder, logger logr.Logger, predicates ...predicate.Predicate) admission.Response {
 	ar := req.AdmissionRequest
+	group, version, kind := ar.Kind.Group, ar.Kind.Version, ar.Kind.Kind
+	operation := string(ar.Operation)
 
 	// Decode object
 	obj := t.DeepCopyObject()
 	_, _, err := decoder.Decode(req.Object.Raw, nil, obj)
 	if err != nil {
+		metrics.DecodeFailuresTotal.WithLabelValues(group, version, kind).Inc()
 		logger.Error(errors.WithStack(err), "could not decode request", "request", ar)
 		return admission.Errored(http.StatusBadRequest, fmt.Errorf("could not decode request %v: %v", ar, err))
 	}
@@ -178,40 +224,111 @@ func handle(ctx context.Context, req admission.Request, m Mutator, t runtime.Obj
 	if len(req.OldObject.Raw) != 0 {
 		oldObj = t.DeepCopyObject()
 		if _, _, err := decoder.Decode(ar.OldObject.Raw, nil, oldObj); err != nil {
+			metrics.DecodeFailuresTotal.WithLabelValues(group, version, kind).Inc()
 			logger.Error(errors.WithStack(err), "could not decode old object", "object", oldObj)
 			return admission.Errored(http.StatusBadRequest, fmt.Errorf("could not decode old object %v: %v", oldObj, err))
 		}
 	}
 
-	// Run object through predicates
-	if !extensionspredicate.EvalGeneric(obj, predicates...) {
+	// Run object through predicates, skipping any predicate that opted out of this request's operation
+	applicablePredicates := make([]predicate.Predicate, 0, len(predicates))
+	for _, p := range predicates {
+		if op, ok := p.(OperationPredicate); ok && !appliesToOperation(ar.Operation, op.ForOperations()) {
+			continue
+		}
+		applicablePredicates = append(applicablePredicates, p)
+	}
+	if !extensionspredicate.EvalGeneric(obj, applicablePredicates...) {
+		metrics.PredicateSkipsTotal.WithLabelValues(group, version, kind, operation).Inc()
+		metrics.AdmissionsTotal.WithLabelValues(group, version, kind, operation, "skipped").Inc()
 		return admission.ValidationResponse(true, "")
 	}
 
-	// Process the resource
-	newObj := obj.DeepCopyObject()
-	if err = m.Mutate(ctx, newObj, oldObj); err != nil {
-		logger.Error(errors.Wrap(err, "could not process"), "admission denied", "kind", ar.Kind.Kind, "namespace", accessor.GetNamespace(), "name", accessor.GetName())
-		return admission.Errored(http.StatusBadRequest, err)
+	var dryRun bool
+	if ar.DryRun != nil {
+		dryRun = *ar.DryRun
+	}
+	ctx = withRequestContext(ctx, RequestContext{DryRun: dryRun, Operation: ar.Operation})
+
+	// The span is a child of whatever ctx already carries. handle itself has no access to the incoming HTTP
+	// request's headers (admission.Request only exposes the decoded AdmissionRequest), so correlating this span
+	// with the calling apiserver's trace requires the webhook server to extract the trace context from the
+	// request headers before calling Handle, e.g. by wrapping the server's http.Handler with otelhttp.NewHandler.
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "Mutate", trace.WithAttributes(
+		attribute.String("gvk", ar.Kind.String()),
+		attribute.String("namespace", accessor.GetNamespace()),
+		attribute.String("name", accessor.GetName()),
+		attribute.String("uid", string(ar.UID)),
+		attribute.Bool("dryRun", dryRun),
+	))
+	defer span.End()
+
+	// Process the resource by feeding it through the mutator chain in registration order. The duration is observed
+	// via defer so that a mutator error, which returns early, is reflected in the histogram just like a success.
+	mutationStart := time.Now()
+	defer func() {
+		metrics.MutationDuration.WithLabelValues(group, version, kind, operation).Observe(time.Since(mutationStart).Seconds())
+	}()
+	current := obj.DeepCopyObject()
+	var warnings []string
+
+	for _, m := range mutators {
+		if om, ok := m.(OperationsMutator); ok && !appliesToOperation(ar.Operation, om.Operations()) {
+			continue
+		}
+
+		next := current.DeepCopyObject()
+
+		var mutatorWarnings []string
+		switch mutator := m.(type) {
+		case WarningMutator:
+			mutatorWarnings, err = mutator.Mutate(ctx, next, oldObj)
+		case Mutator:
+			err = mutator.Mutate(ctx, next, oldObj)
+		default:
+			return admission.Errored(http.StatusInternalServerError, errors.Errorf("unexpected mutator type %T", m))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.Error(errors.Wrap(err, "could not process"), "admission denied", "kind", ar.Kind.Kind, "namespace", accessor.GetNamespace(), "name", accessor.GetName())
+			metrics.AdmissionsTotal.WithLabelValues(group, version, kind, operation, "errored").Inc()
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		warnings = append(warnings, mutatorWarnings...)
+
+		_, isValidator := m.(Validator)
+		_, isWarningValidator := m.(WarningValidator)
+		if !isValidator && !isWarningValidator {
+			current = next
+		}
 	}
 
-	_, isValidator := m.(Validator)
+	var resp admission.Response
+
 	// Return a patch response if the resource should be changed
-	if !isValidator && !equality.Semantic.DeepEqual(obj, newObj) {
+	if !equality.Semantic.DeepEqual(obj, current) {
 		oldObjMarshaled, err := json.Marshal(obj)
 		if err != nil {
 			return admission.Errored(http.StatusInternalServerError, err)
 		}
-		newObjMarshaled, err := json.Marshal(newObj)
+		newObjMarshaled, err := json.Marshal(current)
 		if err != nil {
 			return admission.Errored(http.StatusInternalServerError, err)
 		}
 
-		return admission.PatchResponseFromRaw(oldObjMarshaled, newObjMarshaled)
+		resp = admission.PatchResponseFromRaw(oldObjMarshaled, newObjMarshaled)
+		if patchBytes, err := json.Marshal(resp.Patches); err == nil {
+			metrics.PatchSizeBytes.WithLabelValues(group, version, kind, operation).Observe(float64(len(patchBytes)))
+		}
+	} else {
+		// Return a validation response if the resource should not be changed
+		resp = admission.ValidationResponse(true, "")
 	}
 
-	// Return a validation response if the resource should not be changed
-	return admission.ValidationResponse(true, "")
+	metrics.AdmissionsTotal.WithLabelValues(group, version, kind, operation, "allowed").Inc()
+	resp.Warnings = warnings
+	return resp
 }
 
 // buildTypesMap builds a map of the given types keyed by their GroupVersionKind, using the scheme from the given Manager.
@@ -0,0 +1,328 @@
+// Copyright (c) 2019 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gardener/gardener/extensions/pkg/webhook/metrics"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var configMapGVK = metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "ConfigMap"}
+
+// newTestRequest builds an admission.Request for the given ConfigMap, ready to be passed to handle together with a
+// decoder built by newTestDecoder.
+func newTestRequest(cm *corev1.ConfigMap, operation admissionv1.Operation, dryRun bool) admission.Request {
+	raw, err := json.Marshal(cm)
+	Expect(err).NotTo(HaveOccurred())
+
+	return admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "test-uid",
+			Kind:      configMapGVK,
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    &dryRun,
+		},
+	}
+}
+
+// newTestDecoder returns a decoder that can decode the ConfigMaps built by newTestRequest.
+func newTestDecoder() runtime.Decoder {
+	scheme := runtime.NewScheme()
+	Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	return serializer.NewCodecFactory(scheme).UniversalDecoder()
+}
+
+// mutatorFunc adapts a function to the Mutator interface.
+type mutatorFunc func(ctx context.Context, new, old runtime.Object) error
+
+func (f mutatorFunc) Mutate(ctx context.Context, new, old runtime.Object) error { return f(ctx, new, old) }
+
+// warningMutatorFunc adapts a function to the WarningMutator interface.
+type warningMutatorFunc func(ctx context.Context, new, old runtime.Object) ([]string, error)
+
+func (f warningMutatorFunc) Mutate(ctx context.Context, new, old runtime.Object) ([]string, error) {
+	return f(ctx, new, old)
+}
+
+// validatorFunc adapts a function to the Validator interface.
+type validatorFunc func(ctx context.Context, new, old runtime.Object) error
+
+func (f validatorFunc) Validate(ctx context.Context, new, old runtime.Object) error { return f(ctx, new, old) }
+
+// warningValidatorFunc adapts a function to the WarningValidator interface.
+type warningValidatorFunc func(ctx context.Context, new, old runtime.Object) ([]string, error)
+
+func (f warningValidatorFunc) Validate(ctx context.Context, new, old runtime.Object) ([]string, error) {
+	return f(ctx, new, old)
+}
+
+var _ = Describe("handle", func() {
+	var cm *corev1.ConfigMap
+
+	BeforeEach(func() {
+		cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	})
+
+	Context("warnings", func() {
+		It("surfaces warnings from a WarningMutator and still applies its mutation", func() {
+			mutator := warningMutatorFunc(func(_ context.Context, new, _ runtime.Object) ([]string, error) {
+				new.(*corev1.ConfigMap).Data = map[string]string{"mutated": "true"}
+				return []string{"mutator warning"}, nil
+			})
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf("mutator warning"))
+			Expect(resp.Patches).NotTo(BeEmpty())
+		})
+
+		It("surfaces warnings from a WarningValidator without mutating the object", func() {
+			validator := &hybridWarningValidator{WarningValidator: warningValidatorFunc(func(_ context.Context, _, _ runtime.Object) ([]string, error) {
+				return []string{"validator warning"}, nil
+			})}
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{validator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Warnings).To(ConsistOf("validator warning"))
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("aggregates warnings from multiple mutators and validators", func() {
+			mutator := warningMutatorFunc(func(_ context.Context, _, _ runtime.Object) ([]string, error) {
+				return []string{"from mutator"}, nil
+			})
+			validator := &hybridWarningValidator{WarningValidator: warningValidatorFunc(func(_ context.Context, _, _ runtime.Object) ([]string, error) {
+				return []string{"from validator"}, nil
+			})}
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator, validator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(resp.Warnings).To(ConsistOf("from mutator", "from validator"))
+		})
+
+		It("denies the request and stops the chain if a validator returns an error", func() {
+			validator := &hybridValidator{Validator: validatorFunc(func(_ context.Context, _, _ runtime.Object) error {
+				return errors.New("not allowed")
+			})}
+			calledAfter := false
+			after := mutatorFunc(func(_ context.Context, _, _ runtime.Object) error {
+				calledAfter = true
+				return nil
+			})
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{validator, after}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(calledAfter).To(BeFalse())
+		})
+	})
+
+	Context("mutator chaining", func() {
+		It("runs multiple mutators registered for the same GVK in registration order, chaining their output", func() {
+			var order []string
+			first := mutatorFunc(func(_ context.Context, new, _ runtime.Object) error {
+				order = append(order, "first")
+				new.(*corev1.ConfigMap).Data = map[string]string{"first": "true"}
+				return nil
+			})
+			second := mutatorFunc(func(_ context.Context, new, _ runtime.Object) error {
+				order = append(order, "second")
+				Expect(new.(*corev1.ConfigMap).Data).To(HaveKeyWithValue("first", "true"))
+				new.(*corev1.ConfigMap).Data["second"] = "true"
+				return nil
+			})
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{first, second}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(order).To(Equal([]string{"first", "second"}))
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).NotTo(BeEmpty())
+		})
+
+		It("leaves the object untouched, and returns a validation response, if no mutator changes anything", func() {
+			noop := mutatorFunc(func(_ context.Context, _, _ runtime.Object) error { return nil })
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{noop}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("dry run and operation filtering", func() {
+		It("skips an OperationsMutator for operations it did not register for", func() {
+			called := false
+			mutator := opsAwareMutator{
+				mutatorFunc: func(_ context.Context, _, _ runtime.Object) error {
+					called = true
+					return nil
+				},
+				ops: []admissionv1.Operation{admissionv1.Update},
+			}
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(called).To(BeFalse())
+			Expect(resp.Allowed).To(BeTrue())
+		})
+
+		It("invokes an OperationsMutator for an operation it did register for", func() {
+			called := false
+			mutator := opsAwareMutator{
+				mutatorFunc: func(_ context.Context, _, _ runtime.Object) error {
+					called = true
+					return nil
+				},
+				ops: []admissionv1.Operation{admissionv1.Create, admissionv1.Update},
+			}
+
+			handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(called).To(BeTrue())
+		})
+
+		It("stores a RequestContext reflecting DryRun and Operation that mutators can retrieve via RequestContextFromContext", func() {
+			var rc RequestContext
+			var ok bool
+			mutator := mutatorFunc(func(ctx context.Context, _, _ runtime.Object) error {
+				rc, ok = RequestContextFromContext(ctx)
+				return nil
+			})
+
+			handle(context.Background(), newTestRequest(cm, admissionv1.Update, true), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(ok).To(BeTrue())
+			Expect(rc.DryRun).To(BeTrue())
+			Expect(rc.Operation).To(Equal(admissionv1.Update))
+		})
+
+		It("skips an OperationPredicate for operations it did not register for, so the request still reaches the mutators", func() {
+			called := false
+			mutator := mutatorFunc(func(_ context.Context, _, _ runtime.Object) error {
+				called = true
+				return nil
+			})
+			pred := operationPredicate{
+				Predicate: predicate.NewPredicateFuncs(func(object client.Object) bool { return false }),
+				ops:       []admissionv1.Operation{admissionv1.Update},
+			}
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard(), pred)
+
+			Expect(called).To(BeTrue())
+			Expect(resp.Allowed).To(BeTrue())
+		})
+
+		It("evaluates an OperationPredicate, and skips the mutator chain, for operations it did register for", func() {
+			called := false
+			mutator := mutatorFunc(func(_ context.Context, _, _ runtime.Object) error {
+				called = true
+				return nil
+			})
+			pred := operationPredicate{
+				Predicate: predicate.NewPredicateFuncs(func(object client.Object) bool { return false }),
+				ops:       []admissionv1.Operation{admissionv1.Create},
+			}
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard(), pred)
+
+			Expect(called).To(BeFalse())
+			Expect(resp.Allowed).To(BeTrue())
+		})
+	})
+
+	Context("metrics", func() {
+		It("counts an allowed admission and observes its mutation duration and patch size", func() {
+			cm.Name = "metrics-allowed"
+			mutator := mutatorFunc(func(_ context.Context, new, _ runtime.Object) error {
+				new.(*corev1.ConfigMap).Data = map[string]string{"mutated": "true"}
+				return nil
+			})
+
+			handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(testutil.ToFloat64(metrics.AdmissionsTotal.WithLabelValues("", "v1", "ConfigMap", "CREATE", "allowed"))).To(BeNumerically(">=", 1))
+			Expect(testutil.CollectAndCount(metrics.MutationDuration)).To(BeNumerically(">=", 1))
+			Expect(testutil.CollectAndCount(metrics.PatchSizeBytes)).To(BeNumerically(">=", 1))
+		})
+
+		It("counts a request skipped by the predicates, without running any mutator", func() {
+			cm.Name = "metrics-skipped"
+			mutator := mutatorFunc(func(_ context.Context, _, _ runtime.Object) error {
+				Fail("mutator should not have been invoked for a predicate-skipped request")
+				return nil
+			})
+			pred := predicate.NewPredicateFuncs(func(object client.Object) bool { return false })
+
+			before := testutil.ToFloat64(metrics.PredicateSkipsTotal.WithLabelValues("", "v1", "ConfigMap", "CREATE"))
+
+			resp := handle(context.Background(), newTestRequest(cm, admissionv1.Create, false), []interface{}{mutator}, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard(), pred)
+
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(testutil.ToFloat64(metrics.PredicateSkipsTotal.WithLabelValues("", "v1", "ConfigMap", "CREATE"))).To(Equal(before + 1))
+		})
+
+		It("counts a decode failure and denies the request", func() {
+			req := newTestRequest(cm, admissionv1.Create, false)
+			req.Object.Raw = []byte(`{"invalid`)
+
+			before := testutil.ToFloat64(metrics.DecodeFailuresTotal.WithLabelValues("", "v1", "ConfigMap"))
+
+			resp := handle(context.Background(), req, nil, &corev1.ConfigMap{}, newTestDecoder(), logr.Discard())
+
+			Expect(resp.Allowed).To(BeFalse())
+			Expect(testutil.ToFloat64(metrics.DecodeFailuresTotal.WithLabelValues("", "v1", "ConfigMap"))).To(Equal(before + 1))
+		})
+	})
+})
+
+// opsAwareMutator adapts a mutatorFunc to additionally implement OperationsMutator, for tests that need to exercise
+// the handler's per-operation mutator filtering. Its Operations method can only be declared at package scope, since
+// Go does not allow methods on types declared inside a function body.
+type opsAwareMutator struct {
+	mutatorFunc
+	ops []admissionv1.Operation
+}
+
+func (m opsAwareMutator) Operations() []admissionv1.Operation { return m.ops }
+
+// operationPredicate adapts a predicate.Predicate to additionally implement OperationPredicate, for tests that need
+// to exercise the handler's per-operation predicate filtering.
+type operationPredicate struct {
+	predicate.Predicate
+	ops []admissionv1.Operation
+}
+
+func (p operationPredicate) ForOperations() []admissionv1.Operation { return p.ops }
@@ -0,0 +1,81 @@
+// Copyright (c) 2019 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exposes the Prometheus metrics recorded by extensions/pkg/webhook's admission handler. Metrics
+// are registered against controller-runtime's global metrics.Registry, so they are served on the manager's existing
+// /metrics endpoint without any further wiring.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const subsystem = "gardener_extension_webhook"
+
+// gvkOperationLabels are the labels shared by the per-GVK/operation metrics below.
+var gvkOperationLabels = []string{"group", "version", "kind", "operation"}
+
+var (
+	// AdmissionsTotal counts admission requests handled by the webhook handler, by group/version/kind, operation
+	// and result ("allowed", "errored" if a mutator or validator returned an error, or "skipped" for requests that did
+	// not match the registered predicates). Requests that fail before the mutator chain runs, e.g. because they could
+	// not be decoded, are not counted here.
+	AdmissionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "admissions_total",
+		Help:      "Total number of admission requests processed by the webhook handler, by group/version/kind, operation and result.",
+	}, append(append([]string{}, gvkOperationLabels...), "result"))
+
+	// DecodeFailuresTotal counts admission requests whose object (or old object) could not be decoded.
+	DecodeFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "decode_failures_total",
+		Help:      "Total number of admission requests that failed to decode, by group/version/kind.",
+	}, []string{"group", "version", "kind"})
+
+	// MutationDuration observes how long the mutator chain took to process an admission request.
+	MutationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: subsystem,
+		Name:      "mutation_duration_seconds",
+		Help:      "Time it took to run the mutator chain for an admission request, by group/version/kind and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, gvkOperationLabels)
+
+	// PatchSizeBytes observes the size, in bytes, of JSON patches returned to the API server.
+	PatchSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Subsystem: subsystem,
+		Name:      "patch_size_bytes",
+		Help:      "Size of the JSON patch returned for an admission request, by group/version/kind and operation.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 6),
+	}, gvkOperationLabels)
+
+	// PredicateSkipsTotal counts admission requests that were let through without mutation because they did not
+	// match the registered predicates.
+	PredicateSkipsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: subsystem,
+		Name:      "predicate_skips_total",
+		Help:      "Total number of admission requests skipped because they did not match the registered predicates, by group/version/kind and operation.",
+	}, gvkOperationLabels)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		AdmissionsTotal,
+		DecodeFailuresTotal,
+		MutationDuration,
+		PatchSizeBytes,
+		PredicateSkipsTotal,
+	)
+}
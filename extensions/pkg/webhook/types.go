@@ -0,0 +1,72 @@
+// Copyright (c) 2019 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Mutator mutates resources.
+type Mutator interface {
+	// Mutate mutates the given object. It can optionally use the old object to calculate the changes.
+	// Note that the old object may be nil if it's an Operation of type `create`.
+	Mutate(ctx context.Context, new, old runtime.Object) error
+}
+
+// Validator validates resources. It must not change the given object.
+type Validator interface {
+	// Validate validates the given object. It can optionally use the old object to decide on the validation.
+	// Note that the old object may be nil if it's an Operation of type `create`.
+	Validate(ctx context.Context, new, old runtime.Object) error
+}
+
+// WarningMutator is a Mutator that can additionally return non-fatal warnings which are surfaced to the caller via
+// the AdmissionResponse, e.g. to advise about a deprecated field without failing the request.
+type WarningMutator interface {
+	// Mutate mutates the given object and returns any warnings that should be surfaced to the caller.
+	Mutate(ctx context.Context, new, old runtime.Object) (warnings []string, err error)
+}
+
+// WarningValidator is a Validator that can additionally return non-fatal warnings which are surfaced to the caller
+// via the AdmissionResponse.
+type WarningValidator interface {
+	// Validate validates the given object and returns any warnings that should be surfaced to the caller.
+	Validate(ctx context.Context, new, old runtime.Object) (warnings []string, err error)
+}
+
+// hybridValidator adapts a Validator to the Mutator interface so it can be registered and processed the same way
+// as a Mutator. It still embeds Validator so the handler can type-assert it back and keep any change it makes to the
+// object out of the mutator chain.
+type hybridValidator struct {
+	Validator
+}
+
+// Mutate implements Mutator by delegating to the wrapped Validator.
+func (h *hybridValidator) Mutate(ctx context.Context, new, old runtime.Object) error {
+	return h.Validate(ctx, new, old)
+}
+
+// hybridWarningValidator is the WarningMutator equivalent of hybridValidator, for validators that also want to
+// surface warnings.
+type hybridWarningValidator struct {
+	WarningValidator
+}
+
+// Mutate implements WarningMutator by delegating to the wrapped WarningValidator.
+func (h *hybridWarningValidator) Mutate(ctx context.Context, new, old runtime.Object) ([]string, error) {
+	return h.Validate(ctx, new, old)
+}
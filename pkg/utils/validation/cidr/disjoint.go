@@ -0,0 +1,167 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cidr
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// parsedCIDR is a CIDR that has already been parsed into its IP and network, so overlap checks don't need to
+// re-parse the same string for every comparison.
+type parsedCIDR struct {
+	raw   string
+	ip    net.IP
+	ipNet *net.IPNet
+}
+
+func parseCIDR(cidr string) (parsedCIDR, error) {
+	ip, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil {
+		return parsedCIDR{}, err
+	}
+	return parsedCIDR{raw: cidr, ip: ip, ipNet: ipNet}, nil
+}
+
+func (p parsedCIDR) isIPv4() bool {
+	return p.ip.To4() != nil
+}
+
+func (p parsedCIDR) overlaps(other parsedCIDR) bool {
+	return p.ipNet.Contains(other.ip) || other.ipNet.Contains(p.ip)
+}
+
+// splitCIDRs splits a single CIDR string into one or two entries, supporting the dual-stack convention of a
+// comma-separated IPv4/IPv6 pair (e.g. "10.0.0.0/16,fd00::/8").
+func splitCIDRs(cidr string) []string {
+	if cidr == "" {
+		return nil
+	}
+
+	var result []string
+	for _, part := range strings.Split(cidr, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func splitCIDRsPtr(cidr *string) []string {
+	if cidr == nil {
+		return nil
+	}
+	return splitCIDRs(*cidr)
+}
+
+// ValidateNetworkDisjointedness validates that the given node, pod and service networks of a shoot are disjoint from
+// the given seed networks; the shoot's networks are not checked against each other. Every parameter accepts either a single CIDR or a
+// comma-separated dual-stack (IPv4 and IPv6) pair; overlap is only ever checked between CIDRs of the same address
+// family, mirroring how Kubernetes itself reasons about dual-stack pod/service ranges.
+func ValidateNetworkDisjointedness(fldPath *field.Path, nodes, pods, services, seedNodes *string, seedPods, seedServices string) field.ErrorList {
+	return validateNetworkDisjointedness(
+		fldPath,
+		splitCIDRsPtr(nodes), splitCIDRsPtr(pods), splitCIDRsPtr(services),
+		splitCIDRsPtr(seedNodes), splitCIDRs(seedPods), splitCIDRs(seedServices),
+	)
+}
+
+// ValidateNetworkDisjointednessDualStack is like ValidateNetworkDisjointedness, but lets callers pass an explicit
+// slice of CIDRs per network (e.g. one entry per address family) instead of a single, optionally comma-separated,
+// string.
+func ValidateNetworkDisjointednessDualStack(fldPath *field.Path, nodes, pods, services, seedNodes, seedPods, seedServices []string) field.ErrorList {
+	return validateNetworkDisjointedness(fldPath, nodes, pods, services, seedNodes, seedPods, seedServices)
+}
+
+func validateNetworkDisjointedness(fldPath *field.Path, nodes, pods, services, seedNodes, seedPods, seedServices []string) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(pods) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("pods"), "pods is required"))
+	}
+	if len(services) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("services"), "services is required"))
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	allSeedCIDRs := make([]string, 0, len(seedNodes)+len(seedPods)+len(seedServices))
+	allSeedCIDRs = append(allSeedCIDRs, seedNodes...)
+	allSeedCIDRs = append(allSeedCIDRs, seedPods...)
+	allSeedCIDRs = append(allSeedCIDRs, seedServices...)
+
+	// The node network is typically provisioned by the infrastructure and may legitimately enclose the seed's pod
+	// and service ranges, so it is only compared against the seed's own node network. Pods and services, on the
+	// other hand, must be disjoint from all three seed networks.
+	for _, network := range []struct {
+		name   string
+		cidrs  []string
+		others []string
+	}{
+		{"nodes", nodes, seedNodes},
+		{"pods", pods, allSeedCIDRs},
+		{"services", services, allSeedCIDRs},
+	} {
+		allErrs = append(allErrs, validateDisjointedness(fldPath.Child(network.name), network.cidrs, network.others)...)
+	}
+
+	return allErrs
+}
+
+// validateDisjointedness checks every CIDR in cidrs against every CIDR in others of the same address family and
+// returns a field.Invalid error for every offending entry in cidrs. When cidrs holds more than one CIDR (e.g. a
+// dual-stack nodes/pods/services network), the error path is indexed so the caller can tell which entry overlapped.
+func validateDisjointedness(fldPath *field.Path, cidrs, others []string) field.ErrorList {
+	var allErrs field.ErrorList
+
+	indexed := len(cidrs) > 1
+
+	// Parse others once up front so the same strings aren't re-parsed for every entry in cidrs.
+	parsedOthers := make([]parsedCIDR, 0, len(others))
+	for _, otherRaw := range others {
+		if other, err := parseCIDR(otherRaw); err == nil {
+			parsedOthers = append(parsedOthers, other)
+		}
+	}
+
+	for i, raw := range cidrs {
+		path := fldPath
+		if indexed {
+			path = fldPath.Index(i)
+		}
+
+		parsed, err := parseCIDR(raw)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path, raw, fmt.Sprintf("invalid CIDR: %v", err)))
+			continue
+		}
+
+		for _, other := range parsedOthers {
+			if parsed.isIPv4() != other.isIPv4() {
+				continue
+			}
+			if parsed.overlaps(other) {
+				allErrs = append(allErrs, field.Invalid(path, raw, fmt.Sprintf("must not overlap with seed network (%s)", other.raw)))
+				break
+			}
+		}
+	}
+
+	return allErrs
+}
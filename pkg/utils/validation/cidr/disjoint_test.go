@@ -130,5 +130,71 @@ var _ = Describe("utils", func() {
 				})),
 			))
 		})
+
+		It("should pass for dual-stack CIDRs given as a comma-separated pair", func() {
+			var (
+				podsCIDR     = "10.242.128.0/17,fd01::/64"
+				servicesCIDR = "10.242.0.0/17,fd02::/64"
+				nodesCIDR    = "10.241.0.0/16,fd03::/64"
+			)
+
+			errorList := ValidateNetworkDisjointedness(
+				field.NewPath(""),
+				&nodesCIDR,
+				&podsCIDR,
+				&servicesCIDR,
+				&seedNodesCIDR,
+				seedPodsCIDR,
+				seedServicesCIDR,
+			)
+
+			Expect(errorList).To(BeEmpty())
+		})
+
+	})
+
+	Describe("#ValidateNetworkDisjointednessDualStack", func() {
+		var (
+			seedPodsCIDR     = []string{"10.241.128.0/17", "fd01::/64"}
+			seedServicesCIDR = []string{"10.241.0.0/17", "fd02::/64"}
+			seedNodesCIDR    = []string{"10.240.0.0/16", "fd03::/64"}
+		)
+
+		It("should pass the validation", func() {
+			errorList := ValidateNetworkDisjointednessDualStack(
+				field.NewPath(""),
+				[]string{"10.241.0.0/16", "fd04::/64"},
+				[]string{"10.242.128.0/17", "fd05::/64"},
+				[]string{"10.242.0.0/17", "fd06::/64"},
+				seedNodesCIDR,
+				seedPodsCIDR,
+				seedServicesCIDR,
+			)
+
+			Expect(errorList).To(BeEmpty())
+		})
+
+		It("should fail due to disjointedness within a single address family and identify the offending index", func() {
+			errorList := ValidateNetworkDisjointednessDualStack(
+				field.NewPath(""),
+				[]string{"10.241.0.0/16", "fd04::/64"},
+				seedPodsCIDR,
+				[]string{"10.242.0.0/17", "fd06::/64"},
+				seedNodesCIDR,
+				seedPodsCIDR,
+				seedServicesCIDR,
+			)
+
+			Expect(errorList).To(ConsistOf(
+				PointTo(MatchFields(IgnoreExtras, Fields{
+					"Type":  Equal(field.ErrorTypeInvalid),
+					"Field": Equal("[].pods[0]"),
+				})),
+				PointTo(MatchFields(IgnoreExtras, Fields{
+					"Type":  Equal(field.ErrorTypeInvalid),
+					"Field": Equal("[].pods[1]"),
+				})),
+			))
+		})
 	})
 })
@@ -0,0 +1,218 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cidr
+
+import (
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// IPBlock mirrors the shape of networking.k8s.io/v1.IPBlock: a CIDR range with a list of sub-ranges that are
+// carved out of it. Addresses falling into Except are not considered part of the block.
+type IPBlock struct {
+	// CIDR is the network that the block describes.
+	CIDR string
+	// Except is a list of CIDRs that are strict subnets of CIDR and are excluded from the block.
+	Except []string
+}
+
+// ValidateNetworkDisjointednessWithExceptions validates that the given node, pod and service IPBlocks of a shoot are
+// disjoint from the given seed IPBlocks, honouring each block's Except ranges the same way a NetworkPolicy IPBlock
+// would: addresses that fall into a block's Except are not considered part of that block for overlap purposes.
+func ValidateNetworkDisjointednessWithExceptions(fldPath *field.Path, nodes, pods, services, seedNodes *IPBlock, seedPods, seedServices IPBlock) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if pods == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("pods"), "pods is required"))
+	}
+	if services == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("services"), "services is required"))
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	remainingNodes, errs := remainingPrefixes(fldPath.Child("nodes"), nodes)
+	allErrs = append(allErrs, errs...)
+	remainingPods, errs := remainingPrefixes(fldPath.Child("pods"), pods)
+	allErrs = append(allErrs, errs...)
+	remainingServices, errs := remainingPrefixes(fldPath.Child("services"), services)
+	allErrs = append(allErrs, errs...)
+	remainingSeedNodes, errs := remainingPrefixes(fldPath.Child("seedNodes"), seedNodes)
+	allErrs = append(allErrs, errs...)
+	remainingSeedPods, errs := remainingPrefixes(fldPath.Child("seedPods"), &seedPods)
+	allErrs = append(allErrs, errs...)
+	remainingSeedServices, errs := remainingPrefixes(fldPath.Child("seedServices"), &seedServices)
+	allErrs = append(allErrs, errs...)
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	allSeedPrefixes := append(append(append([]*net.IPNet{}, remainingSeedNodes...), remainingSeedPods...), remainingSeedServices...)
+
+	// As with the plain CIDR check, the node network is only compared against the seed's node network, while pods
+	// and services must be disjoint from all three seed networks.
+	for _, network := range []struct {
+		name   string
+		cidrs  []*net.IPNet
+		others []*net.IPNet
+	}{
+		{"nodes", remainingNodes, remainingSeedNodes},
+		{"pods", remainingPods, allSeedPrefixes},
+		{"services", remainingServices, allSeedPrefixes},
+	} {
+		if overlapsAny(network.cidrs, network.others) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(network.name), cidrOf(network.name, nodes, pods, services), "must not overlap with seed network"))
+		}
+	}
+
+	return allErrs
+}
+
+// cidrOf returns the raw CIDR string for the given network name, used purely for error reporting.
+func cidrOf(name string, nodes, pods, services *IPBlock) string {
+	switch name {
+	case "nodes":
+		if nodes != nil {
+			return nodes.CIDR
+		}
+		return ""
+	case "pods":
+		return pods.CIDR
+	default:
+		return services.CIDR
+	}
+}
+
+// remainingPrefixes parses block's CIDR, validates that every entry in Except is a strict subnet of it, and returns
+// the set of prefixes that remain once the excepted sub-ranges have been carved out.
+func remainingPrefixes(fldPath *field.Path, block *IPBlock) ([]*net.IPNet, field.ErrorList) {
+	if block == nil {
+		return nil, nil
+	}
+
+	var allErrs field.ErrorList
+
+	_, base, err := net.ParseCIDR(block.CIDR)
+	if err != nil {
+		return nil, field.ErrorList{field.Invalid(fldPath.Child("cidr"), block.CIDR, fmt.Sprintf("invalid CIDR: %v", err))}
+	}
+
+	baseOnes, _ := base.Mask.Size()
+	excepts := make([]*net.IPNet, 0, len(block.Except))
+	for i, exceptCIDR := range block.Except {
+		exceptIP, exceptNet, err := net.ParseCIDR(exceptCIDR)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("except").Index(i), exceptCIDR, fmt.Sprintf("invalid CIDR: %v", err)))
+			continue
+		}
+		exceptOnes, _ := exceptNet.Mask.Size()
+		if !base.Contains(exceptIP) || exceptOnes <= baseOnes {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("except").Index(i), exceptCIDR, fmt.Sprintf("must be a strict subnet of %s", block.CIDR)))
+			continue
+		}
+		excepts = append(excepts, exceptNet)
+	}
+
+	if len(allErrs) > 0 {
+		return nil, allErrs
+	}
+
+	return subtractAll(base, excepts), nil
+}
+
+// overlapsAny reports whether any prefix in a overlaps any prefix in b of the same address family.
+func overlapsAny(a, b []*net.IPNet) bool {
+	for _, pa := range a {
+		for _, pb := range b {
+			if (pa.IP.To4() != nil) != (pb.IP.To4() != nil) {
+				continue
+			}
+			if pa.Contains(pb.IP) || pb.Contains(pa.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subtractAll removes every network in excepts from base, returning the remaining prefixes.
+func subtractAll(base *net.IPNet, excepts []*net.IPNet) []*net.IPNet {
+	remaining := []*net.IPNet{base}
+	for _, except := range excepts {
+		var next []*net.IPNet
+		for _, prefix := range remaining {
+			next = append(next, subtractOne(prefix, except)...)
+		}
+		remaining = next
+	}
+	return remaining
+}
+
+// subtractOne removes except from base, splitting base into the minimal set of prefixes that cover base minus
+// except. base and except are assumed to come from the same address family.
+func subtractOne(base, except *net.IPNet) []*net.IPNet {
+	if !base.Contains(except.IP) && !except.Contains(base.IP) {
+		return []*net.IPNet{base}
+	}
+
+	baseOnes, bits := base.Mask.Size()
+	exceptOnes, _ := except.Mask.Size()
+	if exceptOnes <= baseOnes {
+		// except is equal to, or a supernet of, base: nothing of base remains.
+		return nil
+	}
+
+	var result []*net.IPNet
+	current := base
+	for {
+		currentOnes, _ := current.Mask.Size()
+		if currentOnes == exceptOnes {
+			break
+		}
+
+		left, right := splitNet(current, bits)
+		if left.Contains(except.IP) {
+			result = append(result, right)
+			current = left
+		} else {
+			result = append(result, left)
+			current = right
+		}
+	}
+
+	return result
+}
+
+// splitNet splits n into its lower and upper half, each one bit more specific than n.
+func splitNet(n *net.IPNet, bits int) (*net.IPNet, *net.IPNet) {
+	ones, _ := n.Mask.Size()
+	newOnes := ones + 1
+
+	leftIP := make(net.IP, len(n.IP))
+	copy(leftIP, n.IP)
+	left := &net.IPNet{IP: leftIP, Mask: net.CIDRMask(newOnes, bits)}
+
+	rightIP := make(net.IP, len(n.IP))
+	copy(rightIP, n.IP)
+	byteIndex := (newOnes - 1) / 8
+	bitIndex := uint(7 - (newOnes-1)%8)
+	rightIP[byteIndex] |= 1 << bitIndex
+	right := &net.IPNet{IP: rightIP, Mask: net.CIDRMask(newOnes, bits)}
+
+	return left, right
+}
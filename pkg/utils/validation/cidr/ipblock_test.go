@@ -0,0 +1,98 @@
+// Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cidr_test
+
+import (
+	. "github.com/gardener/gardener/pkg/utils/validation/cidr"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+)
+
+var _ = Describe("IPBlock", func() {
+	Describe("#ValidateNetworkDisjointednessWithExceptions", func() {
+		var (
+			seedNodes    = &IPBlock{CIDR: "10.240.0.0/16"}
+			seedPods     = IPBlock{CIDR: "10.241.128.0/17"}
+			seedServices = IPBlock{CIDR: "10.241.0.0/17"}
+		)
+
+		It("should pass the validation", func() {
+			nodes := &IPBlock{CIDR: "10.241.0.0/16"}
+			pods := &IPBlock{CIDR: "10.242.128.0/17"}
+			services := &IPBlock{CIDR: "10.242.0.0/17"}
+
+			errorList := ValidateNetworkDisjointednessWithExceptions(field.NewPath(""), nodes, pods, services, seedNodes, seedPods, seedServices)
+
+			Expect(errorList).To(BeEmpty())
+		})
+
+		It("should fail if the shoot pod network overlaps the seed pod network", func() {
+			nodes := &IPBlock{CIDR: "10.241.0.0/16"}
+			pods := &IPBlock{CIDR: seedPods.CIDR}
+			services := &IPBlock{CIDR: "10.242.0.0/17"}
+
+			errorList := ValidateNetworkDisjointednessWithExceptions(field.NewPath(""), nodes, pods, services, seedNodes, seedPods, seedServices)
+
+			Expect(errorList).To(ConsistOf(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Type":  Equal(field.ErrorTypeInvalid),
+				"Field": Equal("[].pods"),
+			}))))
+		})
+
+		It("should pass if the overlap is fully covered by the seed's except ranges", func() {
+			nodes := &IPBlock{CIDR: "10.241.0.0/16"}
+			pods := &IPBlock{CIDR: "10.241.192.0/18"}
+			services := &IPBlock{CIDR: "10.242.0.0/17"}
+
+			seedPodsWithException := IPBlock{CIDR: seedPods.CIDR, Except: []string{"10.241.192.0/18"}}
+
+			errorList := ValidateNetworkDisjointednessWithExceptions(field.NewPath(""), nodes, pods, services, seedNodes, seedPodsWithException, seedServices)
+
+			Expect(errorList).To(BeEmpty())
+		})
+
+		It("should reject an except range that is not a strict subnet of its parent CIDR", func() {
+			nodes := &IPBlock{CIDR: "10.241.0.0/16"}
+			pods := &IPBlock{CIDR: "10.242.128.0/17", Except: []string{"10.0.0.0/8"}}
+			services := &IPBlock{CIDR: "10.242.0.0/17"}
+
+			errorList := ValidateNetworkDisjointednessWithExceptions(field.NewPath(""), nodes, pods, services, seedNodes, seedPods, seedServices)
+
+			Expect(errorList).To(ConsistOf(PointTo(MatchFields(IgnoreExtras, Fields{
+				"Type":  Equal(field.ErrorTypeInvalid),
+				"Field": Equal("[].pods.except[0]"),
+			}))))
+		})
+
+		It("should fail due to missing fields", func() {
+			errorList := ValidateNetworkDisjointednessWithExceptions(field.NewPath(""), nil, nil, nil, seedNodes, seedPods, seedServices)
+
+			Expect(errorList).To(ConsistOf(
+				PointTo(MatchFields(IgnoreExtras, Fields{
+					"Type":  Equal(field.ErrorTypeRequired),
+					"Field": Equal("[].pods"),
+				})),
+				PointTo(MatchFields(IgnoreExtras, Fields{
+					"Type":  Equal(field.ErrorTypeRequired),
+					"Field": Equal("[].services"),
+				})),
+			))
+		})
+	})
+})